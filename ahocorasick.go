@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// MultiPattern is a single named entry from a signature file, e.g. a line
+// "evil_stub = DE AD ?? EF".
+type MultiPattern struct {
+	Name    string
+	Pattern *Pattern
+}
+
+// parseSignatureFile reads a signature file of "name = pattern" lines (blank
+// lines and lines starting with "#" are ignored), one named Pattern per
+// line, using the same wildcard syntax as parsePattern.
+func parseSignatureFile(path string) ([]MultiPattern, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var patterns []MultiPattern
+	lineNo := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected \"name = pattern\"", path, lineNo)
+		}
+
+		pattern, err := parsePattern(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		pattern.ID = strings.TrimSpace(name)
+		patterns = append(patterns, MultiPattern{Name: pattern.ID, Pattern: pattern})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("%s: no patterns defined", path)
+	}
+	return patterns, nil
+}
+
+// acNode is one state of the Aho-Corasick automaton, keyed on the literal
+// anchor bytes of each pattern. goto_ is the full transition function: once
+// built, goto_[b] is always a valid state for every byte b, so matching
+// never needs to walk fail links at scan time.
+type acNode struct {
+	goto_  [256]int
+	fail   int
+	output []int // indices into the patterns slice whose anchor ends here
+}
+
+func newACNode() acNode {
+	n := acNode{}
+	for b := range n.goto_ {
+		n.goto_[b] = -1
+	}
+	return n
+}
+
+// buildTrie builds the Aho-Corasick automaton for the given literal anchor
+// keys, where keys[i] is the trie key for pattern i (nil/empty keys, i.e.
+// all-wildcard patterns, are skipped - they have no literal anchor to key
+// on and are matched separately).
+func buildTrie(keys [][]byte) []acNode {
+	nodes := []acNode{newACNode()}
+
+	for id, key := range keys {
+		if len(key) == 0 {
+			continue
+		}
+		cur := 0
+		for _, b := range key {
+			if nodes[cur].goto_[b] == -1 {
+				nodes = append(nodes, newACNode())
+				nodes[cur].goto_[b] = len(nodes) - 1
+			}
+			cur = nodes[cur].goto_[b]
+		}
+		nodes[cur].output = append(nodes[cur].output, id)
+	}
+
+	// Unset transitions out of the root loop back to the root itself.
+	for b := 0; b < 256; b++ {
+		if nodes[0].goto_[b] == -1 {
+			nodes[0].goto_[b] = 0
+		}
+	}
+
+	// BFS over the trie, completing goto_ into a full transition function
+	// and computing fail links and their output union along the way.
+	var queue []int
+	for b := 0; b < 256; b++ {
+		if v := nodes[0].goto_[b]; v != 0 {
+			nodes[v].fail = 0
+			queue = append(queue, v)
+		}
+	}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		nodes[u].output = append(nodes[u].output, nodes[nodes[u].fail].output...)
+
+		for b := 0; b < 256; b++ {
+			v := nodes[u].goto_[b]
+			if v == -1 {
+				nodes[u].goto_[b] = nodes[nodes[u].fail].goto_[b]
+				continue
+			}
+			nodes[v].fail = nodes[nodes[u].fail].goto_[b]
+			queue = append(queue, v)
+		}
+	}
+
+	return nodes
+}
+
+// MultiScanner searches for many named Patterns in a single pass using an
+// Aho-Corasick automaton built from each pattern's literal anchor bytes
+// (see Pattern.anchorStart/anchorLen), turning N-pattern scanning from
+// O(N*filesize) into O(filesize + matches). Patterns that begin and end
+// with wildcards everywhere (no literal anchor at all) fall back to a
+// direct per-pattern scan of each window.
+type MultiScanner struct {
+	patterns     []MultiPattern
+	nodes        []acNode
+	wildcardOnly []int
+	windowSize   int
+	overlap      int
+}
+
+// NewMultiScanner builds a MultiScanner for the given named patterns.
+func NewMultiScanner(patterns []MultiPattern) *MultiScanner {
+	keys := make([][]byte, len(patterns))
+	maxLen := 0
+	var wildcardOnly []int
+	for i, p := range patterns {
+		if p.Pattern.anchorLen == 0 {
+			wildcardOnly = append(wildcardOnly, i)
+		} else {
+			keys[i] = p.Pattern.Bytes[p.Pattern.anchorStart : p.Pattern.anchorStart+p.Pattern.anchorLen]
+		}
+		if l := len(p.Pattern.Bytes); l > maxLen {
+			maxLen = l
+		}
+	}
+
+	overlap := maxLen - 1
+	if overlap < 0 {
+		overlap = 0
+	}
+
+	return &MultiScanner{
+		patterns:     patterns,
+		nodes:        buildTrie(keys),
+		wildcardOnly: wildcardOnly,
+		windowSize:   defaultWindowSize,
+		overlap:      overlap,
+	}
+}
+
+// findAll runs the automaton (plus the wildcard-only fallback) over data
+// once, returning every verified match. newSince bounds which matches are
+// reported: a match is only returned if it extends past newSince, since
+// anything entirely before it was already reported against a prior window.
+func (s *MultiScanner) findAll(data []byte, newSince int) []Match {
+	var matches []Match
+
+	cur := 0
+	for i, b := range data {
+		cur = s.nodes[cur].goto_[b]
+		for _, patID := range s.nodes[cur].output {
+			mp := s.patterns[patID]
+			anchorStart := i - mp.Pattern.anchorLen + 1
+			patternStart := anchorStart - mp.Pattern.anchorStart
+			patternLen := len(mp.Pattern.Bytes)
+			if patternStart < 0 || patternStart+patternLen > len(data) || patternStart+patternLen <= newSince {
+				continue
+			}
+			if !mp.Pattern.matchesAt(data, patternStart) {
+				continue
+			}
+			matches = append(matches, newMultiMatch(mp.Name, data, patternStart, patternLen))
+		}
+	}
+
+	for _, idx := range s.wildcardOnly {
+		mp := s.patterns[idx]
+		patternLen := len(mp.Pattern.Bytes)
+		for _, pos := range findPattern(data, mp.Pattern) {
+			if int(pos)+patternLen <= newSince {
+				continue
+			}
+			matches = append(matches, newMultiMatch(mp.Name, data, int(pos), patternLen))
+		}
+	}
+
+	return matches
+}
+
+// newMultiMatch builds a Match for a pattern found at data[pos:pos+length],
+// capturing up to contextSize bytes of surrounding data on each side.
+func newMultiMatch(patternID string, data []byte, pos, length int) Match {
+	before := max(0, pos-contextSize)
+	after := min(len(data), pos+length+contextSize)
+	return Match{
+		Offset:        int64(pos),
+		Length:        int64(length),
+		PatternID:     patternID,
+		ContextBefore: cloneBytes(data[before:pos]),
+		ContextAfter:  cloneBytes(data[pos+length : after]),
+	}
+}
+
+// ScanFile opens path and scans it for every pattern, returning a channel
+// of matches closed once the scan completes (or fails).
+func (s *MultiScanner) ScanFile(path string) (<-chan Match, error) {
+	return scanFileWith(path, s.ScanStream)
+}
+
+// ScanStream searches r for every pattern and emits matches (tagged with
+// their pattern's name) on the returned channel, which is closed when r is
+// exhausted. Like Scanner.ScanStream, successive read windows keep an
+// overlap - here sized to the longest pattern - so matches straddling a
+// window boundary are never missed or double-reported.
+func (s *MultiScanner) ScanStream(file string, r io.Reader) <-chan Match {
+	out := make(chan Match)
+
+	go func() {
+		defer close(out)
+
+		windowSize := s.windowSize
+		if windowSize <= s.overlap {
+			windowSize = s.overlap + defaultWindowSize
+		}
+		buf := make([]byte, windowSize)
+
+		var base int64
+		carry := 0
+		for {
+			n, err := io.ReadFull(r, buf[carry:])
+			total := carry + n
+
+			if n > 0 {
+				for _, m := range s.findAll(buf[:total], carry) {
+					m.File = file
+					m.Offset += base
+					out <- m
+				}
+			}
+
+			if err != nil {
+				break
+			}
+
+			keep := s.overlap
+			if keep > total {
+				keep = total
+			}
+			copy(buf[:keep], buf[total-keep:total])
+			base += int64(total - keep)
+			carry = keep
+		}
+	}()
+
+	return out
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ulikunitz/xz"
+)
+
+// defaultMaxRecurseDepth bounds how many nested containers -recurse will
+// follow, guarding against zip-bomb-style nesting.
+const defaultMaxRecurseDepth = 8
+
+// scanPath scans path for the scanner's pattern. When recurse is true it
+// transparently descends into .tar, .tar.gz/.tgz, .tar.bz2/.tbz2, .zip, and
+// raw gzip/bzip2/xz streams, reporting matches inside a container as
+// "archive!inner/path", up to maxDepth levels of nesting.
+func scanPath(scanner PatternScanner, path string, recurse bool, maxDepth int) (<-chan Match, error) {
+	if !recurse {
+		return scanner.ScanFile(path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Match)
+	go func() {
+		defer close(out)
+		defer f.Close()
+		scanEntry(scanner, path, path, f, maxDepth, out)
+	}()
+	return out, nil
+}
+
+// scanEntry scans a single named stream. displayName is the "archive!path"
+// label used to report matches; sniffName is the (possibly shorter) name
+// used purely to detect the next container layer. If depth permits and the
+// stream is a recognized archive or compression format, scanEntry peels or
+// expands one layer and recurses; otherwise it scans the stream directly.
+func scanEntry(scanner PatternScanner, displayName, sniffName string, r io.Reader, depth int, out chan<- Match) {
+	if depth > 0 {
+		if inner, nextSniff, ok := peelCompression(sniffName, r); ok {
+			scanEntry(scanner, displayName, nextSniff, inner, depth-1, out)
+			return
+		}
+
+		switch lower := strings.ToLower(sniffName); {
+		case strings.HasSuffix(lower, ".tar"):
+			scanTarEntries(scanner, displayName, r, depth-1, out)
+			return
+		case strings.HasSuffix(lower, ".zip"):
+			scanZipEntries(scanner, displayName, r, depth-1, out)
+			return
+		}
+	}
+
+	for m := range scanner.ScanStream(displayName, r) {
+		out <- m
+	}
+}
+
+// peelCompression strips one gzip/bzip2/xz layer off name/r, returning a
+// reader over the decompressed stream and the name that layer decompresses
+// to (".tgz" -> ".tar", ".gz" stripped entirely, and so on). ok is false if
+// name doesn't carry a recognized compression suffix.
+func peelCompression(name string, r io.Reader) (inner io.Reader, nextName string, ok bool) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, "", false
+		}
+		return gz, name[:len(name)-4] + ".tar", true
+	case strings.HasSuffix(lower, ".gz"):
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, "", false
+		}
+		return gz, name[:len(name)-3], true
+	case strings.HasSuffix(lower, ".tbz2"):
+		return bzip2.NewReader(r), name[:len(name)-5] + ".tar", true
+	case strings.HasSuffix(lower, ".bz2"):
+		return bzip2.NewReader(r), name[:len(name)-4], true
+	case strings.HasSuffix(lower, ".txz"):
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, "", false
+		}
+		return xr, name[:len(name)-4] + ".tar", true
+	case strings.HasSuffix(lower, ".xz"):
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, "", false
+		}
+		return xr, name[:len(name)-3], true
+	}
+	return nil, "", false
+}
+
+// scanTarEntries streams every regular file in the tar stream r through
+// scanEntry without buffering the archive as a whole.
+func scanTarEntries(scanner PatternScanner, archiveName string, r io.Reader, depth int, out chan<- Match) {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			return
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		scanEntry(scanner, archiveName+"!"+hdr.Name, hdr.Name, tr, depth, out)
+	}
+}
+
+// scanZipEntries streams every regular file in the zip archive r through
+// scanEntry. zip.Reader needs random access to the central directory, so a
+// top-level zip (an *os.File) is read in place; a zip nested inside another
+// container is buffered in memory first since depth is already bounded.
+func scanZipEntries(scanner PatternScanner, archiveName string, r io.Reader, depth int, out chan<- Match) {
+	ra, size, err := readerAt(r)
+	if err != nil {
+		return
+	}
+	zr, err := zip.NewReader(ra, size)
+	if err != nil {
+		return
+	}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			continue
+		}
+		scanEntry(scanner, archiveName+"!"+f.Name, f.Name, rc, depth, out)
+		rc.Close()
+	}
+}
+
+// readerAt adapts r to an io.ReaderAt plus its size, using the file directly
+// when possible and otherwise buffering it fully in memory.
+func readerAt(r io.Reader) (io.ReaderAt, int64, error) {
+	if f, ok := r.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, 0, err
+		}
+		return f, info.Size(), nil
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
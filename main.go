@@ -1,135 +1,362 @@
-package main
-
-import (
-	"bufio"
-	"bytes"
-	"encoding/hex"
-	"fmt"
-	"io"
-	"os"
-	"path/filepath"
-	"strings"
-)
-
-// findPattern locates all occurrences of the pattern in binary data.
-func findPattern(data, pattern []byte) []int64 {
-	var positions []int64
-	dataLen := int64(len(data))
-	patternLen := int64(len(pattern))
-
-	for i := int64(0); i <= dataLen-patternLen; i++ {
-		if bytes.Equal(data[i:i+patternLen], pattern) {
-			positions = append(positions, i)
-		}
-	}
-	return positions
-}
-
-// parsePattern tries to interpret the input as either hex or raw binary bytes.
-func parsePattern(input string) ([]byte, error) {
-	// Try interpreting as hex
-	pattern, err := hex.DecodeString(input)
-	if err == nil {
-		return pattern, nil
-	}
-
-	// Try interpreting as raw bytes (e.g., "0xDE 0xAD 0xBE 0xEF" or "DE AD BE EF")
-	parts := strings.Fields(input)
-	pattern = make([]byte, len(parts))
-	for i, part := range parts {
-		// Remove "0x" prefix if it exists
-		part = strings.TrimPrefix(part, "0x")
-		// Parse each byte as hex
-		byteValue, err := hex.DecodeString(part)
-		if err != nil || len(byteValue) != 1 {
-			return nil, fmt.Errorf("invalid byte format: %s", part)
-		}
-		pattern[i] = byteValue[0]
-	}
-	return pattern, nil
-}
-
-func main() {
-	reader := bufio.NewReader(os.Stdin)
-
-	// Prompt user to drag and drop files into the console
-	fmt.Println("Please drag and drop files into this console, then press Enter to proceed:")
-	filesInput, _ := reader.ReadString('\n')
-	filesInput = strings.TrimSpace(filesInput) // Remove whitespace and newline characters
-	files := filepath.SplitList(filesInput)
-
-	// Trim quotes from file paths
-	for i, filePath := range files {
-		files[i] = strings.Trim(filePath, "\"")
-	}
-
-	if len(files) == 0 {
-		fmt.Println("Error: No files provided. Please drag and drop at least one file.")
-		return
-	}
-
-	// Prompt user to enter a binary pattern
-	var pattern []byte
-	for {
-		fmt.Print("Enter the binary pattern to search for (e.g., 'deadbeef' or '0xDE 0xAD 0xBE 0xEF'): ")
-		patternInput, _ := reader.ReadString('\n')
-		patternInput = strings.TrimSpace(patternInput)
-
-		var err error
-		pattern, err = parsePattern(patternInput)
-		if err != nil {
-			fmt.Println("Invalid pattern format. Please try again.")
-			continue
-		}
-		break
-	}
-
-	// Iterate over each file path provided
-	for _, filePath := range files {
-		// Debug output to see the exact file path being processed
-		fmt.Printf("\nSearching for pattern in file: '%s'\n", filePath)
-
-		// Check if the file exists
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			fmt.Printf("Error: File %s does not exist. Skipping.\n", filePath)
-			continue
-		}
-
-		// Open the file
-		file, err := os.Open(filePath)
-		if err != nil {
-			fmt.Printf("Error opening file %s: %v\n", filePath, err)
-			continue
-		}
-		defer file.Close()
-
-		// Read and search the file in chunks
-		const chunkSize = 4096
-		var offset int64
-		for {
-			buf := make([]byte, chunkSize)
-			n, err := file.Read(buf)
-			if err != nil && err != io.EOF {
-				fmt.Printf("Error reading file %s: %v\n", filePath, err)
-				break
-			}
-			if n == 0 {
-				break
-			}
-
-			// Search for the pattern within the current chunk
-			positions := findPattern(buf[:n], pattern)
-			for _, pos := range positions {
-				fmt.Printf("Pattern found in %s at offset %d\n", filePath, offset+pos)
-			}
-
-			// Update the offset for the next chunk
-			offset += int64(n)
-		}
-		fmt.Printf("Pattern search completed for file: %s\n", filepath.Base(filePath))
-	}
-
-	// Keep the console open by prompting the user to press Enter to exit
-	fmt.Println("\nSearch complete. Press Enter to exit.")
-	reader.ReadString('\n')
-}
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	patternFlag   = flag.String("pattern", "", "binary pattern to search for, e.g. 'deadbeef' or 'DE AD ?? EF' (required unless -rules or no arguments are given)")
+	rulesFlag     = flag.String("rules", "", "signature file of \"name = pattern\" lines to scan for in a single pass, instead of -pattern")
+	formatFlag    = flag.String("format", "text", "output format: text, json, or csv")
+	recurseFlag   = flag.Bool("recurse", false, "descend into .tar/.zip/.gz/.bz2/.xz containers")
+	maxDepthFlag  = flag.Int("max-depth", defaultMaxRecurseDepth, "maximum container nesting depth when -recurse is set")
+	symbolizeFlag = flag.Bool("symbolize", false, "translate offsets in ELF/PE/Mach-O binaries to section/symbol info")
+)
+
+// Pattern is a parsed byte pattern that may contain IDA/YARA-style wildcards:
+// "??" skips a whole byte and "?" skips a single nibble (e.g. "?5" or "4?").
+// Bytes holds the literal value for each position (0 where fully wildcarded)
+// and Mask holds which bits of that byte must actually match.
+type Pattern struct {
+	Bytes []byte
+	Mask  []byte
+
+	// ID identifies this pattern in Match.PatternID. Single-pattern CLI
+	// usage always scans pattern "0"; a signature file with multiple named
+	// patterns assigns each its own name instead.
+	ID string
+
+	// anchor is the longest contiguous run of fully-literal bytes (Mask ==
+	// 0xFF), used to drive the Boyer-Moore-Horspool search. anchorLen == 0
+	// means the pattern is all wildcards.
+	anchorStart int
+	anchorLen   int
+	shift       [256]int
+}
+
+// matchesAt reports whether the pattern matches data at the given offset,
+// honoring per-nibble wildcards.
+func (p *Pattern) matchesAt(data []byte, offset int) bool {
+	for i, mask := range p.Mask {
+		if mask == 0 {
+			continue
+		}
+		if data[offset+i]&mask != p.Bytes[i]&mask {
+			return false
+		}
+	}
+	return true
+}
+
+// longestLiteralRun finds the longest contiguous run of fully-literal
+// (Mask == 0xFF) bytes in the pattern, returning its start offset and length.
+func longestLiteralRun(mask []byte) (start, length int) {
+	bestStart, bestLen := 0, 0
+	curStart, curLen := 0, 0
+	for i, m := range mask {
+		if m == 0xFF {
+			if curLen == 0 {
+				curStart = i
+			}
+			curLen++
+			if curLen > bestLen {
+				bestStart, bestLen = curStart, curLen
+			}
+		} else {
+			curLen = 0
+		}
+	}
+	return bestStart, bestLen
+}
+
+// newPattern builds a Pattern from parsed bytes/mask, precomputing the
+// Boyer-Moore-Horspool bad-character shift table over the longest literal
+// run so wildcard positions never need to be consulted during the fast scan.
+func newPattern(data, mask []byte) *Pattern {
+	p := &Pattern{Bytes: data, Mask: mask, ID: "0"}
+	p.anchorStart, p.anchorLen = longestLiteralRun(mask)
+
+	for i := range p.shift {
+		p.shift[i] = p.anchorLen
+	}
+	anchor := data[p.anchorStart : p.anchorStart+p.anchorLen]
+	for i := 0; i < p.anchorLen-1; i++ {
+		p.shift[anchor[i]] = p.anchorLen - 1 - i
+	}
+	return p
+}
+
+// findPattern locates all occurrences of the pattern in binary data using a
+// Boyer-Moore-Horspool search anchored on the pattern's longest run of
+// literal (non-wildcard) bytes, verifying the full mask on each candidate.
+func findPattern(data []byte, pattern *Pattern) []int64 {
+	var positions []int64
+	dataLen := len(data)
+	patternLen := len(pattern.Bytes)
+	if patternLen == 0 || dataLen < patternLen {
+		return nil
+	}
+
+	// A fully-wildcard pattern has no anchor to search on; fall back to a
+	// direct scan since every offset is a candidate anyway.
+	if pattern.anchorLen == 0 {
+		for i := 0; i <= dataLen-patternLen; i++ {
+			if pattern.matchesAt(data, i) {
+				positions = append(positions, int64(i))
+			}
+		}
+		return positions
+	}
+
+	anchor := pattern.Bytes[pattern.anchorStart : pattern.anchorStart+pattern.anchorLen]
+	last := pattern.anchorLen - 1
+
+	// i is the offset of the anchor window within data.
+	i := 0
+	for i <= dataLen-pattern.anchorLen {
+		window := data[i : i+pattern.anchorLen]
+		if window[last] == anchor[last] && bytes.Equal(window, anchor) {
+			patternStart := i - pattern.anchorStart
+			if patternStart >= 0 && patternStart+patternLen <= dataLen && pattern.matchesAt(data, patternStart) {
+				positions = append(positions, int64(patternStart))
+			}
+		}
+		i += pattern.shift[window[last]]
+	}
+	return positions
+}
+
+// parsePattern tries to interpret the input as hex, raw bytes, or a
+// whitespace-separated token list containing wildcards ("??" or per-nibble
+// "?"), e.g. "DE AD ?? EF" or "48 8B ?5".
+func parsePattern(input string) (*Pattern, error) {
+	if !strings.ContainsAny(input, "? \t") {
+		// Plain hex string, no wildcards and no spaces.
+		if raw, err := hex.DecodeString(input); err == nil {
+			mask := make([]byte, len(raw))
+			for i := range mask {
+				mask[i] = 0xFF
+			}
+			return newPattern(raw, mask), nil
+		}
+	}
+
+	parts := strings.Fields(input)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	data := make([]byte, len(parts))
+	mask := make([]byte, len(parts))
+	for i, part := range parts {
+		part = strings.TrimPrefix(part, "0x")
+		if len(part) != 2 {
+			return nil, fmt.Errorf("invalid byte format: %s", part)
+		}
+
+		b, m, err := parseNibblePair(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte format: %s: %w", part, err)
+		}
+		data[i] = b
+		mask[i] = m
+	}
+	return newPattern(data, mask), nil
+}
+
+// parseNibblePair parses a two-character token like "DE", "?5", "4?", or
+// "??" into a literal byte value and the mask of bits that must match.
+func parseNibblePair(tok string) (value, mask byte, err error) {
+	high, err := parseNibble(tok[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	low, err := parseNibble(tok[1])
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if high.wildcard {
+		mask &^= 0xF0
+	} else {
+		value |= high.value << 4
+		mask |= 0xF0
+	}
+	if low.wildcard {
+		mask &^= 0x0F
+	} else {
+		value |= low.value
+		mask |= 0x0F
+	}
+	return value, mask, nil
+}
+
+type nibble struct {
+	value    byte
+	wildcard bool
+}
+
+func parseNibble(c byte) (nibble, error) {
+	if c == '?' {
+		return nibble{wildcard: true}, nil
+	}
+	v, err := hex.DecodeString("0" + string(c))
+	if err != nil || len(v) != 1 {
+		return nibble{}, fmt.Errorf("invalid hex nibble: %c", c)
+	}
+	return nibble{value: v[0] & 0x0F}, nil
+}
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+
+	if *patternFlag == "" && *rulesFlag == "" && len(args) == 0 {
+		runInteractive()
+		return
+	}
+
+	if *patternFlag == "" && *rulesFlag == "" {
+		fmt.Fprintln(os.Stderr, "Error: -pattern or -rules is required when files are given on the command line")
+		os.Exit(1)
+	}
+	if *patternFlag != "" && *rulesFlag != "" {
+		fmt.Fprintln(os.Stderr, "Error: -pattern and -rules are mutually exclusive")
+		os.Exit(1)
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Error: at least one file must be provided")
+		os.Exit(1)
+	}
+
+	var scanner PatternScanner
+	if *rulesFlag != "" {
+		patterns, err := parseSignatureFile(*rulesFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		scanner = NewMultiScanner(patterns)
+	} else {
+		pattern, err := parsePattern(*patternFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid pattern: %v\n", err)
+			os.Exit(1)
+		}
+		scanner = NewScanner(pattern)
+	}
+
+	w, err := NewResultWriter(os.Stdout, *formatFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer w.Close()
+
+	narrate := *formatFlag == "" || *formatFlag == "text"
+	for _, filePath := range args {
+		scanAndReport(scanner, filePath, w, narrate)
+	}
+}
+
+// runInteractive reproduces binja's original drag-and-drop prompt, used
+// whenever no -pattern or file arguments are given on the command line.
+func runInteractive() {
+	reader := bufio.NewReader(os.Stdin)
+
+	// Prompt user to drag and drop files into the console
+	fmt.Println("Please drag and drop files into this console, then press Enter to proceed:")
+	filesInput, _ := reader.ReadString('\n')
+	filesInput = strings.TrimSpace(filesInput) // Remove whitespace and newline characters
+	files := filepath.SplitList(filesInput)
+
+	// Trim quotes from file paths
+	for i, filePath := range files {
+		files[i] = strings.Trim(filePath, "\"")
+	}
+
+	if len(files) == 0 {
+		fmt.Println("Error: No files provided. Please drag and drop at least one file.")
+		return
+	}
+
+	// Prompt user to enter a binary pattern
+	var pattern *Pattern
+	for {
+		fmt.Print("Enter the binary pattern to search for (e.g., 'deadbeef', '0xDE 0xAD 0xBE 0xEF', or 'DE AD ?? EF'): ")
+		patternInput, _ := reader.ReadString('\n')
+		patternInput = strings.TrimSpace(patternInput)
+
+		var err error
+		pattern, err = parsePattern(patternInput)
+		if err != nil {
+			fmt.Println("Invalid pattern format. Please try again.")
+			continue
+		}
+		break
+	}
+
+	w, _ := NewResultWriter(os.Stdout, "text")
+	scanner := NewScanner(pattern)
+	for _, filePath := range files {
+		scanAndReport(scanner, filePath, w, true)
+	}
+
+	// Keep the console open by prompting the user to press Enter to exit
+	fmt.Println("\nSearch complete. Press Enter to exit.")
+	reader.ReadString('\n')
+}
+
+// scanAndReport scans filePath with scanner and reports every match through
+// w. When narrate is true (text output), it also prints the same
+// progress/error chatter the interactive prompt has always printed;
+// structured (json/csv) output stays free of anything but records.
+func scanAndReport(scanner PatternScanner, filePath string, w ResultWriter, narrate bool) {
+	if narrate {
+		fmt.Printf("\nSearching for pattern in file: '%s'\n", filePath)
+	}
+
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if narrate {
+			fmt.Printf("Error: File %s does not exist. Skipping.\n", filePath)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: file %s does not exist\n", filePath)
+		}
+		return
+	}
+
+	matches, err := scanPath(scanner, filePath, *recurseFlag, *maxDepthFlag)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening file %s: %v\n", filePath, err)
+		return
+	}
+
+	// Symbolizing only makes sense against raw file offsets, which
+	// -recurse matches no longer are (they're offsets into a decompressed
+	// inner stream), so it's skipped in that mode.
+	var sym *Symbolizer
+	if *symbolizeFlag && !*recurseFlag {
+		if s, err := OpenSymbolizer(filePath); err == nil {
+			sym = s
+			defer sym.Close()
+		}
+	}
+
+	for m := range matches {
+		if err := w.WriteMatch(m, sym); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing match for %s: %v\n", filePath, err)
+			return
+		}
+	}
+
+	if narrate {
+		fmt.Printf("Pattern search completed for file: %s\n", filepath.Base(filePath))
+	}
+}
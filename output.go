@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Record is the structured, pipeline-friendly representation of a Match,
+// used by the json and csv output formats.
+type Record struct {
+	File          string `json:"file"`
+	Offset        int64  `json:"offset"`
+	Length        int64  `json:"length"`
+	PatternID     string `json:"pattern_id"`
+	ContextBefore string `json:"context_before"`
+	ContextAfter  string `json:"context_after"`
+}
+
+func newRecord(m Match) Record {
+	return Record{
+		File:          m.File,
+		Offset:        m.Offset,
+		Length:        m.Length,
+		PatternID:     m.PatternID,
+		ContextBefore: hex.EncodeToString(m.ContextBefore),
+		ContextAfter:  hex.EncodeToString(m.ContextAfter),
+	}
+}
+
+// ResultWriter reports matches in one of the supported output formats.
+type ResultWriter interface {
+	// WriteMatch reports m. sym, if non-nil, is a Symbolizer for m's file
+	// and is only consulted by the text format.
+	WriteMatch(m Match, sym *Symbolizer) error
+	Close() error
+}
+
+// NewResultWriter returns a ResultWriter for the named format ("text",
+// "json", or "csv"; "" defaults to "text").
+func NewResultWriter(w io.Writer, format string) (ResultWriter, error) {
+	switch format {
+	case "", "text":
+		return &textResultWriter{w: w}, nil
+	case "json":
+		return &jsonResultWriter{enc: json.NewEncoder(w)}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write([]string{"file", "offset", "length", "pattern_id", "context_before", "context_after"}); err != nil {
+			return nil, err
+		}
+		return &csvResultWriter{cw: cw}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q (want text, json, or csv)", format)
+	}
+}
+
+// textResultWriter renders matches as the same human-readable lines the
+// interactive prompt has always printed, symbolizing offsets when sym is
+// available.
+type textResultWriter struct {
+	w io.Writer
+}
+
+func (tw *textResultWriter) WriteMatch(m Match, sym *Symbolizer) error {
+	if sym != nil {
+		if info, ok := sym.Resolve(m.Offset); ok {
+			if info.Symbol != "" {
+				_, err := fmt.Fprintf(tw.w, "Pattern found in %s at %#x (%s+%#x, va=%#x, %s+%#x)\n",
+					m.File, m.Offset, info.Section, info.SectionOffset, info.VirtualAddress, info.Symbol, info.SymbolDelta)
+				return err
+			}
+			_, err := fmt.Fprintf(tw.w, "Pattern found in %s at %#x (%s+%#x, va=%#x)\n",
+				m.File, m.Offset, info.Section, info.SectionOffset, info.VirtualAddress)
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(tw.w, "Pattern found in %s at offset %d\n", m.File, m.Offset)
+	return err
+}
+
+func (tw *textResultWriter) Close() error { return nil }
+
+// jsonResultWriter writes one JSON record per line (JSON Lines), so results
+// can be streamed into downstream tooling as they're found.
+type jsonResultWriter struct {
+	enc *json.Encoder
+}
+
+func (jw *jsonResultWriter) WriteMatch(m Match, _ *Symbolizer) error {
+	return jw.enc.Encode(newRecord(m))
+}
+
+func (jw *jsonResultWriter) Close() error { return nil }
+
+// csvResultWriter writes one CSV row per match, after an initial header row.
+type csvResultWriter struct {
+	cw *csv.Writer
+}
+
+func (cw *csvResultWriter) WriteMatch(m Match, _ *Symbolizer) error {
+	r := newRecord(m)
+	return cw.cw.Write([]string{
+		r.File,
+		strconv.FormatInt(r.Offset, 10),
+		strconv.FormatInt(r.Length, 10),
+		r.PatternID,
+		r.ContextBefore,
+		r.ContextAfter,
+	})
+}
+
+func (cw *csvResultWriter) Close() error {
+	cw.cw.Flush()
+	return cw.cw.Error()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/exp/mmap"
+)
+
+// Match describes a single pattern occurrence found by a Scanner.
+type Match struct {
+	File      string
+	Offset    int64
+	Length    int64
+	PatternID string
+
+	// ContextBefore and ContextAfter are up to contextSize bytes of data
+	// immediately surrounding the match, clipped at whatever window edge
+	// the match happened to fall near.
+	ContextBefore []byte
+	ContextAfter  []byte
+}
+
+const (
+	// defaultWindowSize is the read buffer used when sliding across an
+	// io.ReaderAt. It is large enough to amortize syscall overhead while
+	// staying well clear of the mmap threshold below.
+	defaultWindowSize = 1 << 20 // 1 MiB
+
+	// mmapThreshold is the file size above which Scanner maps the file
+	// into memory instead of copying it through read buffers.
+	mmapThreshold = 64 << 20 // 64 MiB
+
+	// contextSize is how many bytes of surrounding data are captured on
+	// each side of a match for -format json/csv output.
+	contextSize = 16
+)
+
+// PatternScanner scans a file or stream for one or more patterns. Scanner
+// and MultiScanner both implement it, so callers like scanPath don't need
+// to care whether they're running a single-pattern or Aho-Corasick scan.
+type PatternScanner interface {
+	ScanFile(path string) (<-chan Match, error)
+	ScanStream(file string, r io.Reader) <-chan Match
+}
+
+// Scanner searches files for a single Pattern, automatically choosing
+// between buffered io.ReaderAt reads and an mmap-backed view depending on
+// file size.
+type Scanner struct {
+	pattern    *Pattern
+	windowSize int
+}
+
+// NewScanner returns a Scanner that searches for pattern.
+func NewScanner(pattern *Pattern) *Scanner {
+	return &Scanner{pattern: pattern, windowSize: defaultWindowSize}
+}
+
+// ScanFile opens path and scans it for the scanner's pattern, returning a
+// channel of matches that is closed once the scan completes (or fails).
+func (s *Scanner) ScanFile(path string) (<-chan Match, error) {
+	return scanFileWith(path, s.ScanStream)
+}
+
+// scanFileWith opens path - mapping it into memory instead of copying it
+// through read buffers when it's at or above mmapThreshold - and runs
+// scanStream over it, closing the underlying file once the returned channel
+// is exhausted. It is the shared file-opening logic behind both Scanner and
+// MultiScanner's ScanFile methods.
+func scanFileWith(path string, scanStream func(file string, r io.Reader) <-chan Match) (<-chan Match, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Size() >= mmapThreshold {
+		r, err := mmap.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		out := scanStream(path, io.NewSectionReader(r, 0, int64(r.Len())))
+		return closeWhenDone(out, r), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	out := scanStream(path, f)
+	return closeWhenDone(out, f), nil
+}
+
+// closeWhenDone drains in, forwards every Match to a new channel, and closes
+// c once in is exhausted, so callers don't need to track reader lifetime.
+func closeWhenDone(in <-chan Match, c io.Closer) <-chan Match {
+	out := make(chan Match)
+	go func() {
+		defer close(out)
+		defer c.Close()
+		for m := range in {
+			out <- m
+		}
+	}()
+	return out
+}
+
+// ScanStream searches r for the scanner's pattern and emits matches on the
+// returned channel, which is closed when r is exhausted. r need not support
+// random access, so ScanStream also backs scanning of archive and
+// compressed-stream entries, which are only readable sequentially.
+// Successive read windows keep a len(pattern)-1 byte overlap so that matches
+// straddling a window boundary are never missed.
+func (s *Scanner) ScanStream(file string, r io.Reader) <-chan Match {
+	out := make(chan Match)
+
+	go func() {
+		defer close(out)
+
+		patternLen := len(s.pattern.Bytes)
+		overlap := patternLen - 1
+		if overlap < 0 {
+			overlap = 0
+		}
+
+		windowSize := s.windowSize
+		if windowSize <= overlap {
+			windowSize = overlap + defaultWindowSize
+		}
+		buf := make([]byte, windowSize)
+
+		var base int64
+		carry := 0
+		for {
+			n, err := io.ReadFull(r, buf[carry:])
+			total := carry + n
+
+			// Only the newly read bytes can contain a match we haven't
+			// already reported; a read of zero with carry left over means
+			// that tail was fully searched as part of the previous window.
+			if n > 0 {
+				for _, pos := range findPattern(buf[:total], s.pattern) {
+					before := max(0, int(pos)-contextSize)
+					after := min(total, int(pos)+patternLen+contextSize)
+					out <- Match{
+						File:          file,
+						Offset:        base + pos,
+						Length:        int64(patternLen),
+						PatternID:     s.pattern.ID,
+						ContextBefore: cloneBytes(buf[before:pos]),
+						ContextAfter:  cloneBytes(buf[int(pos)+patternLen : after]),
+					}
+				}
+			}
+
+			if err != nil {
+				break
+			}
+
+			keep := overlap
+			if keep > total {
+				keep = total
+			}
+			copy(buf[:keep], buf[total-keep:total])
+			base += int64(total - keep)
+			carry = keep
+		}
+	}()
+
+	return out
+}
+
+// cloneBytes copies b, since it may point into a scan buffer that gets
+// overwritten on the next read.
+func cloneBytes(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	out := make([]byte, len(b))
+	copy(out, b)
+	return out
+}
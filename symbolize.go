@@ -0,0 +1,213 @@
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// Symbolized describes where a raw file offset lands inside a parsed
+// ELF/PE/Mach-O image.
+type Symbolized struct {
+	Section        string
+	SectionOffset  uint64
+	VirtualAddress uint64
+	Symbol         string
+	SymbolDelta    uint64
+}
+
+// symSection is a format-agnostic view of one section/segment: the file
+// range it occupies and the virtual address its first byte is loaded at.
+type symSection struct {
+	name          string
+	fileOff, size uint64
+	addr          uint64
+}
+
+// symEntry is a format-agnostic named address, used for nearest-symbol
+// lookup.
+type symEntry struct {
+	name string
+	addr uint64
+}
+
+// Symbolizer resolves raw file offsets of an ELF, PE, or Mach-O binary into
+// section-relative and virtual addresses, annotated with the nearest
+// preceding symbol.
+type Symbolizer struct {
+	file     *os.File
+	sections []symSection
+	symbols  []symEntry // sorted by addr ascending
+}
+
+// OpenSymbolizer detects path's binary format and opens a Symbolizer for it.
+// It returns an error if path isn't a recognized ELF, PE, or Mach-O image.
+func OpenSymbolizer(path string) (*Symbolizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ef, err := elf.NewFile(f); err == nil {
+		return newSymbolizer(f, elfSections(ef), elfSymbols(ef)), nil
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if pf, err := pe.NewFile(f); err == nil {
+		return newSymbolizer(f, peSections(pf), peSymbols(pf)), nil
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if mf, err := macho.NewFile(f); err == nil {
+		return newSymbolizer(f, machoSections(mf), machoSymbols(mf)), nil
+	}
+
+	f.Close()
+	return nil, fmt.Errorf("%s: not a recognized ELF, PE, or Mach-O image", path)
+}
+
+func newSymbolizer(f *os.File, sections []symSection, symbols []symEntry) *Symbolizer {
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].addr < symbols[j].addr })
+	return &Symbolizer{file: f, sections: sections, symbols: symbols}
+}
+
+// Close releases the underlying file.
+func (s *Symbolizer) Close() error {
+	return s.file.Close()
+}
+
+// Resolve maps a raw file offset to its containing section, virtual
+// address, and nearest preceding symbol. ok is false if offset doesn't fall
+// inside any known section.
+func (s *Symbolizer) Resolve(offset int64) (sym Symbolized, ok bool) {
+	off := uint64(offset)
+	for _, sec := range s.sections {
+		if off < sec.fileOff || off >= sec.fileOff+sec.size {
+			continue
+		}
+		sym.Section = sec.name
+		sym.SectionOffset = off - sec.fileOff
+		sym.VirtualAddress = sec.addr + sym.SectionOffset
+		sym.Symbol, sym.SymbolDelta = s.nearestSymbol(sym.VirtualAddress)
+		return sym, true
+	}
+	return Symbolized{}, false
+}
+
+// nearestSymbol returns the name and delta of the last symbol at or before
+// addr, or ("", 0) if none precedes it.
+func (s *Symbolizer) nearestSymbol(addr uint64) (string, uint64) {
+	i := sort.Search(len(s.symbols), func(i int) bool { return s.symbols[i].addr > addr }) - 1
+	if i < 0 {
+		return "", 0
+	}
+	return s.symbols[i].name, addr - s.symbols[i].addr
+}
+
+func elfSections(ef *elf.File) []symSection {
+	var out []symSection
+	for _, sec := range ef.Sections {
+		if sec.Type == elf.SHT_NOBITS || sec.Addr == 0 || sec.Size == 0 {
+			continue
+		}
+		out = append(out, symSection{name: sec.Name, fileOff: sec.Offset, size: sec.Size, addr: sec.Addr})
+	}
+	return out
+}
+
+func elfSymbols(ef *elf.File) []symEntry {
+	var out []symEntry
+	for _, list := range [][]elf.Symbol{symbolsOrNil(ef.Symbols), symbolsOrNil(ef.DynamicSymbols)} {
+		for _, sym := range list {
+			if sym.Name == "" || sym.Value == 0 {
+				continue
+			}
+			out = append(out, symEntry{name: sym.Name, addr: sym.Value})
+		}
+	}
+	return out
+}
+
+// symbolsOrNil calls an *elf.File symbol accessor and swallows the "no
+// symbol section" error, since stripped binaries simply have none.
+func symbolsOrNil(fn func() ([]elf.Symbol, error)) []elf.Symbol {
+	syms, err := fn()
+	if err != nil {
+		return nil
+	}
+	return syms
+}
+
+func peImageBase(pf *pe.File) uint64 {
+	switch oh := pf.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		return uint64(oh.ImageBase)
+	case *pe.OptionalHeader64:
+		return oh.ImageBase
+	}
+	return 0
+}
+
+func peSections(pf *pe.File) []symSection {
+	base := peImageBase(pf)
+	var out []symSection
+	for _, sec := range pf.Sections {
+		if sec.Size == 0 || sec.VirtualAddress == 0 {
+			continue
+		}
+		out = append(out, symSection{
+			name:    sec.Name,
+			fileOff: uint64(sec.Offset),
+			size:    uint64(sec.Size),
+			addr:    base + uint64(sec.VirtualAddress),
+		})
+	}
+	return out
+}
+
+func peSymbols(pf *pe.File) []symEntry {
+	base := peImageBase(pf)
+	var out []symEntry
+	for _, sym := range pf.Symbols {
+		if sym.Name == "" || int(sym.SectionNumber) <= 0 || int(sym.SectionNumber) > len(pf.Sections) {
+			continue
+		}
+		sec := pf.Sections[sym.SectionNumber-1]
+		out = append(out, symEntry{name: sym.Name, addr: base + uint64(sec.VirtualAddress) + uint64(sym.Value)})
+	}
+	return out
+}
+
+func machoSections(mf *macho.File) []symSection {
+	var out []symSection
+	for _, sec := range mf.Sections {
+		if sec.Size == 0 || sec.Addr == 0 {
+			continue
+		}
+		out = append(out, symSection{name: sec.Name, fileOff: uint64(sec.Offset), size: sec.Size, addr: sec.Addr})
+	}
+	return out
+}
+
+func machoSymbols(mf *macho.File) []symEntry {
+	if mf.Symtab == nil {
+		return nil
+	}
+	var out []symEntry
+	for _, sym := range mf.Symtab.Syms {
+		if sym.Name == "" || sym.Value == 0 {
+			continue
+		}
+		out = append(out, symEntry{name: sym.Name, addr: sym.Value})
+	}
+	return out
+}